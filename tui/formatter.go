@@ -0,0 +1,258 @@
+package tui
+
+import (
+	"strings"
+	"time"
+
+	arbor "github.com/arborchat/arbor-go"
+	runewidth "github.com/mattn/go-runewidth"
+)
+
+// MessageFormatter renders a single chat message into the lines that
+// HistoryState.Render should draw for it. isCurrent indicates whether
+// message is the currently-selected message and should be highlighted.
+// highlights carries the byte ranges of message.Content that an active
+// search matched, so implementations can highlight them inline.
+// Implementations decide how much context (timestamps, date separators,
+// coloring) to surface alongside the message content.
+type MessageFormatter interface {
+	Format(message *arbor.ChatMessage, width int, isCurrent bool, highlights [][2]int) [][]byte
+}
+
+// resettableFormatter is implemented by formatters that accumulate state
+// across the messages in a single Render pass (such as
+// TimestampFormatter's day-boundary tracking) and need that state cleared
+// before each new pass, since Render re-formats its whole visible window
+// from scratch on every call.
+type resettableFormatter interface {
+	Reset()
+}
+
+// wrapAndHighlight wraps content to fit within messageWidth columns,
+// prefixing the first line with firstLinePrefix and indenting continuation
+// lines with otherLinePrefix. highlights are byte ranges into content that
+// get wrapped in MatchColor/ClearColor; a range that spans a wrap boundary
+// is highlighted separately on each physical line it touches. If isCurrent
+// is true, the rendered lines are also bracketed in
+// CurrentColor/ClearColor. Each row of output is returned as its own byte
+// slice, newline-terminated.
+func wrapAndHighlight(content string, messageWidth int, firstLinePrefix, otherLinePrefix string, isCurrent bool, highlights [][2]int) [][]byte {
+	outputLines := make([][]byte, 1)
+	wrapped := runewidth.Wrap(content, messageWidth)
+	wrappedLines := strings.SplitAfter(wrapped, "\n")
+	//ensure last line ends with newline
+	lastLine := wrappedLines[len(wrappedLines)-1]
+	if (len(lastLine) > 0 && lastLine[len(lastLine)-1] != '\n') || len(lastLine) == 0 {
+		wrappedLines[len(wrappedLines)-1] = lastLine + "\n"
+	}
+	if len(highlights) > 0 {
+		wrappedHighlights := remapHighlights(content, wrapped, highlights)
+		offset := 0
+		for i, line := range wrappedLines {
+			wrappedLines[i] = highlightLine(line, offset, wrappedHighlights)
+			offset += len(line)
+		}
+	}
+	if isCurrent {
+		wrappedLines[0] = CurrentColor + wrappedLines[0]
+		last := len(wrappedLines) - 1
+		// every wrappedLines entry is newline-terminated (ensured above), and
+		// the Renderer treats each output row as exactly one terminal line,
+		// so ClearColor must land before that newline rather than after it.
+		wrappedLines[last] = strings.TrimSuffix(wrappedLines[last], "\n") + ClearColor + "\n"
+	}
+	outputLines[0] = []byte(firstLinePrefix + wrappedLines[0])
+	for i := 1; i < len(wrappedLines); i++ {
+		outputLines = append(outputLines, []byte(otherLinePrefix+wrappedLines[i]))
+	}
+	return outputLines
+}
+
+// remapHighlights translates highlights from byte offsets into content to
+// byte offsets into wrapped, the string runewidth.Wrap produced from
+// content. runewidth.Wrap only preserves length when it replaces a space
+// with a newline; when a word is longer than the wrap width it inserts a
+// newline without consuming any bytes from content, which shifts every
+// offset after that point. Ranges that can't be mapped (shouldn't happen
+// for well-formed input) are dropped rather than highlighting the wrong
+// text.
+func remapHighlights(content, wrapped string, highlights [][2]int) [][2]int {
+	contentToWrapped := mapContentOffsetsToWrapped(content, wrapped)
+	remapped := make([][2]int, 0, len(highlights))
+	for _, h := range highlights {
+		start, end := h[0], h[1]
+		if start < 0 || end > len(contentToWrapped) || start > end {
+			continue
+		}
+		remapped = append(remapped, [2]int{contentToWrapped[start], contentToWrapped[end]})
+	}
+	return remapped
+}
+
+// mapContentOffsetsToWrapped walks content and wrapped in lockstep,
+// recording at each index i of content (plus one final entry for
+// len(content)) the corresponding byte offset in wrapped. The two strings
+// agree byte-for-byte except where runewidth.Wrap has replaced a space
+// with a newline (consumes one byte from each string) or inserted a hard
+// wrap in the middle of an over-long word (consumes a byte from wrapped
+// only).
+func mapContentOffsetsToWrapped(content, wrapped string) []int {
+	offsets := make([]int, len(content)+1)
+	i, j := 0, 0
+	for i < len(content) {
+		offsets[i] = j
+		switch {
+		case j < len(wrapped) && wrapped[j] == '\n' && content[i] != '\n':
+			// a hard wrap was inserted here; it may or may not have
+			// consumed the content byte (a replaced space does, a
+			// mid-word break doesn't), so only advance wrapped and
+			// re-examine this same content byte against what follows.
+			j++
+			if i < len(content) && content[i] == ' ' {
+				i++
+			}
+		default:
+			i++
+			j++
+		}
+	}
+	offsets[len(content)] = j
+	return offsets
+}
+
+// highlightLine wraps whatever portion of line falls within highlights
+// (byte ranges into the wrapped content that line was split from, with
+// lineOffset as line's own starting offset in that wrapped content) in
+// MatchColor/ClearColor. The trailing newline is never highlighted, so a
+// match that runs across a wrap boundary closes on its own row.
+func highlightLine(line string, lineOffset int, highlights [][2]int) string {
+	body := strings.TrimSuffix(line, "\n")
+	lineEnd := lineOffset + len(body)
+	var b strings.Builder
+	pos := 0
+	for _, r := range highlights {
+		start, end := r[0], r[1]
+		if end <= lineOffset || start >= lineEnd {
+			continue
+		}
+		if start < lineOffset {
+			start = lineOffset
+		}
+		if end > lineEnd {
+			end = lineEnd
+		}
+		start, end = start-lineOffset, end-lineOffset
+		if start < pos {
+			start = pos
+		}
+		if start >= end {
+			continue
+		}
+		b.WriteString(body[pos:start])
+		b.WriteString(MatchColor)
+		b.WriteString(body[start:end])
+		b.WriteString(ClearColor)
+		pos = end
+	}
+	b.WriteString(body[pos:])
+	b.WriteString(line[len(body):])
+	return b.String()
+}
+
+// UsernameFormatter is the default MessageFormatter. It prefixes each
+// message with "username: " and wraps continuation lines under that
+// prefix. If a user "foo" sent a long message, the result should look
+// like:
+//
+//`foo: jsdkfljsdfkljsfkljsdkfj
+//      jskfldjfkdjsflsdkfjsldf
+//      jksdfljskdfjslkfjsldkfj`
+//
+// The important thing to note is that lines are broken at the same place
+// and that subsequent lines are padded with runewidth(username)+2 spaces.
+type UsernameFormatter struct{}
+
+// Format implements MessageFormatter.
+func (UsernameFormatter) Format(message *arbor.ChatMessage, width int, isCurrent bool, highlights [][2]int) [][]byte {
+	const separator = ": "
+	usernameWidth := runewidth.StringWidth(message.Username)
+	separatorWidth := runewidth.StringWidth(separator)
+	firstLinePrefix := message.Username + separator
+	otherLinePrefix := strings.Repeat(" ", usernameWidth+separatorWidth)
+	messageRenderWidth := width - (usernameWidth + separatorWidth)
+	return wrapAndHighlight(message.Content, messageRenderWidth, firstLinePrefix, otherLinePrefix, isCurrent, highlights)
+}
+
+const (
+	// defaultTimestampFormat is used by TimestampFormatter when
+	// TimestampFormat is unset.
+	defaultTimestampFormat = "15:04:05"
+	// dateSeparatorFormat is the layout used to render the date banner
+	// inserted whenever the calendar day changes between messages.
+	dateSeparatorFormat = "January 2, 2006"
+	// dateSeparatorRule is repeated on either side of the date banner to
+	// pad it to the full render width.
+	dateSeparatorRule = "─"
+)
+
+// TimestampFormatter prepends a timestamp column to each message and
+// inserts a full-width "── January 2, 2006 ──" separator line whenever the
+// calendar day changes between two adjacent messages.
+type TimestampFormatter struct {
+	// TimestampFormat is passed to time.Time.Format to render the
+	// timestamp column. Defaults to defaultTimestampFormat if empty.
+	TimestampFormat string
+
+	// lastDay is the date banner text for the previously-formatted
+	// message within the current Render pass, used to detect when a day
+	// boundary has been crossed. It is empty until the first message of
+	// the pass has been formatted; Reset clears it between passes.
+	lastDay string
+}
+
+// Reset implements resettableFormatter. It clears the day-boundary state
+// so the next Render pass compares each message's day only against other
+// messages in that same pass, not against the last message of whatever
+// pass rendered previously.
+func (t *TimestampFormatter) Reset() {
+	t.lastDay = ""
+}
+
+// Format implements MessageFormatter.
+func (t *TimestampFormatter) Format(message *arbor.ChatMessage, width int, isCurrent bool, highlights [][2]int) [][]byte {
+	format := t.TimestampFormat
+	if format == "" {
+		format = defaultTimestampFormat
+	}
+	sent := time.Unix(message.Timestamp, 0)
+
+	var outputLines [][]byte
+	day := sent.Format(dateSeparatorFormat)
+	if t.lastDay != "" && t.lastDay != day {
+		outputLines = append(outputLines, dateSeparatorLine(day, width))
+	}
+	t.lastDay = day
+
+	const separator = " | "
+	prefix := sent.Format(format) + separator + message.Username + separator
+	prefixWidth := runewidth.StringWidth(prefix)
+	otherLinePrefix := strings.Repeat(" ", prefixWidth)
+	messageRenderWidth := width - prefixWidth
+	outputLines = append(outputLines, wrapAndHighlight(message.Content, messageRenderWidth, prefix, otherLinePrefix, isCurrent, highlights)...)
+	return outputLines
+}
+
+// dateSeparatorLine renders a full-width date banner, e.g.
+// "── January 2, 2006 ──", padded with dateSeparatorRule to fill width.
+func dateSeparatorLine(day string, width int) []byte {
+	label := " " + day + " "
+	labelWidth := runewidth.StringWidth(label)
+	if width <= labelWidth {
+		return []byte(label + "\n")
+	}
+	leftWidth := (width - labelWidth) / 2
+	rightWidth := width - labelWidth - leftWidth
+	left := strings.Repeat(dateSeparatorRule, leftWidth)
+	right := strings.Repeat(dateSeparatorRule, rightWidth)
+	return []byte(left + label + right + "\n")
+}
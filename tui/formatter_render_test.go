@@ -0,0 +1,63 @@
+package tui
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	arbor "github.com/arborchat/arbor-go"
+)
+
+// TestRenderedLinesAreSingleRow guards the Renderer's contract that every
+// formatter output line maps to exactly one terminal row: a highlighted
+// line must not contain an embedded newline, since Renderer.Render drives
+// cursor movement purely from each line's index in the frame.
+func TestRenderedLinesAreSingleRow(t *testing.T) {
+	h, err := NewHistoryState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetDimensions(10, 40)
+	for i, uuid := range []string{"a", "b", "c"} {
+		if err := h.New(&arbor.ChatMessage{UUID: uuid, Username: "bob", Content: "msg", Timestamp: int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, message := range h.History {
+		for _, line := range h.RenderMessage(message, h.renderWidth) {
+			if n := strings.Count(string(line), "\n"); n != 1 {
+				t.Fatalf("RenderMessage line for %q has %d newlines, want exactly 1 (trailing): %q", message.UUID, n, line)
+			}
+		}
+	}
+}
+
+// TestCursorMoveDoesNotCorruptSubsequentFrame reproduces the regression
+// where a mis-placed ClearColor embedded a newline mid-row, causing the
+// renderer to clobber the next row on a later Render call.
+func TestCursorMoveDoesNotCorruptSubsequentFrame(t *testing.T) {
+	h, err := NewHistoryState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetDimensions(10, 40)
+	for i, uuid := range []string{"a", "b", "c", "d", "e"} {
+		if err := h.New(&arbor.ChatMessage{UUID: uuid, Username: "bob", Content: "msg", Timestamp: int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := h.Render(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	h.CursorDown()
+	buf.Reset()
+	if err := h.Render(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "\n"+ClearColor) {
+		t.Fatalf("ClearColor appears immediately after a newline, meaning it escaped its own row: %q", buf.String())
+	}
+}
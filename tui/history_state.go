@@ -1,12 +1,14 @@
 package tui
 
 import (
+	"fmt"
 	"io"
-	"sort"
 	"strings"
 
 	arbor "github.com/arborchat/arbor-go"
 	runewidth "github.com/mattn/go-runewidth"
+
+	"github.com/jwhett/muscadine/tui/render"
 )
 
 // HistoryState maintains the state of what is visible in the client and
@@ -19,6 +21,46 @@ type HistoryState struct {
 	renderWidth, renderHeight int
 	current                   string
 	currentIndex              int
+	// scrollOffset is the number of messages the viewport has been scrolled
+	// back from the most recent message. A value of 0 means the viewport is
+	// anchored to the bottom of history.
+	scrollOffset int
+	// renderer diffs each frame against the last one so Render only has to
+	// repaint rows that actually changed.
+	renderer *render.Renderer
+	// formatter renders each message into the lines Render draws for it.
+	formatter MessageFormatter
+	// search holds the results of the most recent call to Search.
+	search searchState
+	// capacity bounds how many messages New keeps in History; 0 means
+	// unbounded.
+	capacity int
+	// overflow persists messages evicted from History so PageUp can page
+	// them back in. Nil if no SpillPath was configured.
+	overflow *overflowLog
+	// overflowed counts messages currently sitting in the overflow log
+	// that haven't been paged back into History.
+	overflowed int
+	// overflowLoaded counts messages at the front of History that were
+	// paged back in by pageInOverflow and are therefore already durably
+	// written to the overflow log. evictOverflow must not re-append them
+	// when it evicts them again, or the log grows without bound.
+	overflowLoaded int
+	// header and footer are sticky rows pinned to the top and bottom of
+	// the render area, e.g. a channel-topic banner and a status line. The
+	// scrollable message region shrinks to make room for them.
+	header, footer []string
+}
+
+// HistoryOptions configures NewHistoryStateWithOptions.
+type HistoryOptions struct {
+	// Capacity bounds how many messages HistoryState keeps in memory at
+	// once. 0 means unbounded, matching NewHistoryState.
+	Capacity int
+	// SpillPath, if set, is where messages evicted past Capacity are
+	// appended as a gob-encoded overflow log, so PageUp can transparently
+	// page them back in. Leave empty to discard evicted messages instead.
+	SpillPath string
 }
 
 const (
@@ -29,16 +71,49 @@ const (
 	CurrentColor = "\x1b[0;31m"
 	// ClearColor is the ANSI escape sequence to return to the default color
 	ClearColor = "\x1b[0;0m"
+	// scrollIndicatorMoreAboveFmt is rendered on the top row of the viewport
+	// when there are earlier messages that have scrolled off the top.
+	scrollIndicatorMoreAboveFmt = "-- more above (%d) --"
+	// scrollIndicatorMoreBelowFmt is rendered on the bottom row of the
+	// viewport when the view has been scrolled back from the latest message.
+	scrollIndicatorMoreBelowFmt = "-- more below (%d) --"
+	// scrollIndicatorEndOfHistory is rendered on the bottom row of the
+	// viewport when the latest message is visible.
+	scrollIndicatorEndOfHistory = "-- end of history --"
 )
 
 // NewHistoryState creates an empty HistoryState ready to be updated.
 func NewHistoryState() (*HistoryState, error) {
 	h := &HistoryState{
-		History: make([]*arbor.ChatMessage, defaultHistoryLength, defaultHistoryCapacity),
+		History:   make([]*arbor.ChatMessage, defaultHistoryLength, defaultHistoryCapacity),
+		renderer:  render.NewRenderer(),
+		formatter: UsernameFormatter{},
 	}
 	return h, nil
 }
 
+// NewHistoryStateWithOptions creates an empty HistoryState bounded
+// according to opts, ready to be updated.
+func NewHistoryStateWithOptions(opts HistoryOptions) (*HistoryState, error) {
+	h, err := NewHistoryState()
+	if err != nil {
+		return nil, err
+	}
+	overflow, err := openOverflowLog(opts.SpillPath)
+	if err != nil {
+		return nil, err
+	}
+	h.capacity = opts.Capacity
+	h.overflow = overflow
+	return h, nil
+}
+
+// Close releases the on-disk overflow log, if one was configured via
+// NewHistoryStateWithOptions.
+func (h *HistoryState) Close() error {
+	return h.overflow.Close()
+}
+
 // lastNElems returns the final `n` elements of the provided slice of messages
 func lastNElems(slice []*arbor.ChatMessage, n int) []*arbor.ChatMessage {
 	if n >= len(slice) {
@@ -55,74 +130,140 @@ func lastNElemsBytes(slice [][]byte, n int) [][]byte {
 	return slice[len(slice)-n:]
 }
 
-// RenderMessage creates a text format of a message that wraps its contents to fit
-// within the provided width. If a user "foo" sent a long message, the result should
-// look like:
-//
-//`foo: jsdkfljsdfkljsfkljsdkfj
-//      jskfldjfkdjsflsdkfjsldf
-//      jksdfljskdfjslkfjsldkfj`
-//
-// The important thing to note is that lines are broken at the same place and that
-// subsequent lines are padded with runewidth(username)+2 spaces. Each row of output is returned
-// as a byte slice.
+// RenderMessage renders message using the HistoryState's active
+// MessageFormatter, highlighting it if it is the currently-selected
+// message. The default formatter prefixes each message with "username: "
+// and wraps continuation lines under that prefix; see SetFormatter to
+// install a different one.
 func (h *HistoryState) RenderMessage(message *arbor.ChatMessage, width int) [][]byte {
-	const separator = ": "
-	usernameWidth := runewidth.StringWidth(message.Username)
-	separatorWidth := runewidth.StringWidth(separator)
-	firstLinePrefix := message.Username + separator
-	otherLinePrefix := strings.Repeat(" ", usernameWidth+separatorWidth)
-	messageRenderWidth := width - (usernameWidth + separatorWidth)
-	outputLines := make([][]byte, 1)
-	wrapped := runewidth.Wrap(message.Content, messageRenderWidth)
-	wrappedLines := strings.SplitAfter(wrapped, "\n")
-	//ensure last line ends with newline
-	lastLine := wrappedLines[len(wrappedLines)-1]
-	if (len(lastLine) > 0 && lastLine[len(lastLine)-1] != '\n') || len(lastLine) == 0 {
-		wrappedLines[len(wrappedLines)-1] = lastLine + "\n"
-	}
-	if h.Current() == message.UUID {
-		wrappedLines[0] = CurrentColor + wrappedLines[0]
-		wrappedLines[len(wrappedLines)-1] += ClearColor
-	}
-	outputLines[0] = []byte(firstLinePrefix + wrappedLines[0])
-	for i := 1; i < len(wrappedLines); i++ {
-		outputLines = append(outputLines, []byte(otherLinePrefix+wrappedLines[i]))
-	}
-	return outputLines
+	return h.formatter.Format(message, width, h.Current() == message.UUID, h.hitsForMessage(message.UUID))
+}
+
+// SetFormatter replaces the MessageFormatter used to render messages.
+func (h *HistoryState) SetFormatter(formatter MessageFormatter) {
+	h.formatter = formatter
+}
+
+// SetTimestampFormat sets the time.Format layout used by the timestamp
+// column when the active formatter is a *TimestampFormatter. It is a
+// no-op for formatters that don't render a timestamp column.
+func (h *HistoryState) SetTimestampFormat(format string) {
+	if t, ok := h.formatter.(*TimestampFormatter); ok {
+		t.TimestampFormat = format
+	}
+}
+
+// SetHeader pins lines at the top of the render area, e.g. a
+// channel-topic banner. The scrollable message region shrinks to make
+// room for them. Pass nil to remove the header.
+func (h *HistoryState) SetHeader(lines []string) {
+	h.header = lines
+}
+
+// SetFooter pins lines at the bottom of the render area, e.g. a status
+// line. The scrollable message region shrinks to make room for them. Pass
+// nil to remove the footer.
+func (h *HistoryState) SetFooter(lines []string) {
+	h.footer = lines
+}
+
+// stickyRows fits lines to renderWidth, wrapping any line too wide to fit
+// instead of letting it overrun the terminal. Embedded ANSI escape codes
+// are left untouched and pass through verbatim.
+func (h *HistoryState) stickyRows(lines []string) []string {
+	var rows []string
+	for _, line := range lines {
+		if runewidth.StringWidth(line) <= h.renderWidth {
+			rows = append(rows, line)
+			continue
+		}
+		rows = append(rows, strings.Split(runewidth.Wrap(line, h.renderWidth), "\n")...)
+	}
+	return rows
+}
+
+// scrollWindow returns the portion of History that is reachable from the
+// current scroll position, i.e. everything up to (but not including)
+// whatever has been scrolled past at the bottom.
+func (h *HistoryState) scrollWindow() []*arbor.ChatMessage {
+	end := len(h.History) - h.scrollOffset
+	if end < 0 {
+		end = 0
+	}
+	if end > len(h.History) {
+		end = len(h.History)
+	}
+	return h.History[:end]
 }
 
 // Render writes the correct contents of the history to the provided
-// writer. Each time it is invoked, it will render the entire history, so the
-// writer should be empty when it is invoked.
+// writer. It diffs the new frame against the last one it painted and only
+// repaints the rows that changed, so the writer need not be empty when it
+// is invoked.
 func (h *HistoryState) Render(target io.Writer) error {
+	if resettable, ok := h.formatter.(resettableFormatter); ok {
+		resettable.Reset()
+	}
+
+	headerRows := h.stickyRows(h.header)
+	footerRows := h.stickyRows(h.footer)
+
+	window := h.scrollWindow()
+	bottomIndicator := scrollIndicatorEndOfHistory
+	if h.scrollOffset > 0 {
+		bottomIndicator = fmt.Sprintf(scrollIndicatorMoreBelowFmt, h.scrollOffset)
+	}
+	// The bottom indicator row is always rendered, but the top "more above"
+	// row is only needed when window has more messages than fit on screen,
+	// so don't reserve it until that's known to be true — otherwise a
+	// history that fits exactly in the viewport would render one row short.
+	messageHeight := h.renderHeight - 1 - len(headerRows) - len(footerRows)
+	if messageHeight < 0 {
+		messageHeight = 0
+	}
+	if len(window) > messageHeight {
+		messageHeight--
+		if messageHeight < 0 {
+			messageHeight = 0
+		}
+	}
 	// ensure we're only working with the maximum number of messages to fill the screen
-	renderableHist := lastNElems(h.History, h.renderHeight)
-	renderedHistLines := make([][]byte, h.renderHeight)
+	renderableHist := lastNElems(window, messageHeight)
+	renderedHistLines := make([][]byte, messageHeight)
 	// render each message onto however many lines it needs and capture them all.
 	for _, message := range renderableHist {
 		lines := h.RenderMessage(message, h.renderWidth)
 		renderedHistLines = append(renderedHistLines, lines...)
 	}
 	// find the lines that will actually be visible in the rendered area
-	renderedHistLines = lastNElemsBytes(renderedHistLines, h.renderHeight)
-	// draw the lines that are visible to the screen
+	renderedHistLines = lastNElemsBytes(renderedHistLines, messageHeight)
+	topIndicator := ""
+	if aboveCount := len(window) - len(renderableHist); aboveCount > 0 {
+		topIndicator = fmt.Sprintf(scrollIndicatorMoreAboveFmt, aboveCount)
+	}
+
+	frame := make([]string, 0, len(headerRows)+len(renderedHistLines)+len(footerRows)+2)
+	frame = append(frame, headerRows...)
+	if topIndicator != "" {
+		frame = append(frame, topIndicator)
+	}
 	for _, line := range renderedHistLines {
-		_, err := target.Write(line)
-		if err != nil {
-			return err
-		}
+		frame = append(frame, strings.TrimSuffix(string(line), "\n"))
 	}
-	return nil
+	frame = append(frame, bottomIndicator)
+	frame = append(frame, footerRows...)
+
+	return h.renderer.Render(target, frame)
 }
 
 // New alerts the HistoryState of a newly received message.
 func (h *HistoryState) New(message *arbor.ChatMessage) error {
 	h.History = append(h.History, message)
-	// ensure the new message is in the proper place
-	sort.Slice(h.History, func(i, j int) bool {
-		return h.History[i].Timestamp < h.History[j].Timestamp
-	})
+	// messages arrive nearly in timestamp order, so walk the new message
+	// back from the tail instead of re-sorting the whole slice.
+	for i := len(h.History) - 1; i > 0 && h.History[i-1].Timestamp > h.History[i].Timestamp; i-- {
+		h.History[i-1], h.History[i] = h.History[i], h.History[i-1]
+	}
 	if h.current == "" {
 		h.current = message.UUID
 		for index, curMsg := range h.History {
@@ -131,6 +272,49 @@ func (h *HistoryState) New(message *arbor.ChatMessage) error {
 			}
 		}
 	}
+	if h.scrollOffset > 0 {
+		// keep the view anchored on the same messages instead of letting it
+		// silently slide toward the bottom as new messages arrive.
+		h.scrollOffset++
+	}
+	return h.evictOverflow()
+}
+
+// evictOverflow trims History back down to capacity, if one is set,
+// appending evicted messages to the overflow log so PageUp can page them
+// back in later. Messages that were themselves just paged in by
+// pageInOverflow are already in the log, so they're dropped from
+// overflowLoaded instead of being re-appended.
+func (h *HistoryState) evictOverflow() error {
+	if h.capacity <= 0 {
+		return nil
+	}
+	for len(h.History) > h.capacity {
+		evictingCurrent := h.History[0].UUID == h.current
+		if h.overflowLoaded > 0 {
+			h.overflowLoaded--
+		} else if err := h.overflow.append(h.History[0]); err != nil {
+			return err
+		}
+		h.History = h.History[1:]
+		if h.overflow != nil {
+			h.overflowed++
+		}
+		switch {
+		case evictingCurrent:
+			// the evicted message was current; it no longer exists in
+			// History, so fall back to the new oldest message instead
+			// of leaving current pointed at a UUID that's gone.
+			h.currentIndex = 0
+			if len(h.History) > 0 {
+				h.current = h.History[0].UUID
+			} else {
+				h.current = ""
+			}
+		case h.currentIndex > 0:
+			h.currentIndex--
+		}
+	}
 	return nil
 }
 
@@ -179,3 +363,67 @@ func (h *HistoryState) CursorUp() {
 	h.current = h.History[h.currentIndex-1].UUID
 	h.currentIndex--
 }
+
+// PageUp scrolls the viewport back by renderHeight messages, revealing
+// older history, without changing which message is current. If the
+// scroll would run past the in-memory window and messages have been
+// evicted to an overflow log, they are transparently paged back in first.
+func (h *HistoryState) PageUp() {
+	if h.overflowed > 0 && h.scrollOffset+h.renderHeight >= len(h.History) {
+		h.pageInOverflow()
+	}
+	maxOffset := len(h.History) - 1
+	if maxOffset < 0 {
+		maxOffset = 0
+	}
+	h.scrollOffset += h.renderHeight
+	if h.scrollOffset > maxOffset {
+		h.scrollOffset = maxOffset
+	}
+}
+
+// pageInOverflow replays the overflow log back into the front of History
+// so PageUp can reach messages that were evicted to stay within capacity.
+// The overflow log itself is left untouched.
+func (h *HistoryState) pageInOverflow() {
+	messages, err := h.overflow.replay()
+	if err != nil || len(messages) == 0 {
+		return
+	}
+	h.History = append(messages, h.History...)
+	h.currentIndex += len(messages)
+	h.overflowed = 0
+	h.overflowLoaded = len(messages)
+}
+
+// PageDown scrolls the viewport forward by renderHeight messages, toward
+// the most recent message, without changing which message is current.
+func (h *HistoryState) PageDown() {
+	h.scrollOffset -= h.renderHeight
+	if h.scrollOffset < 0 {
+		h.scrollOffset = 0
+	}
+}
+
+// ScrollTo moves the viewport so that the message with the given uuid is
+// visible, without changing which message is current. It does nothing if
+// no message with that uuid is in history.
+func (h *HistoryState) ScrollTo(uuid string) {
+	for index, msg := range h.History {
+		if msg.UUID == uuid {
+			h.scrollOffset = len(h.History) - index - 1
+			if h.scrollOffset < 0 {
+				h.scrollOffset = 0
+			}
+			return
+		}
+	}
+}
+
+// ScrollPosition reports how far the viewport has scrolled back from the
+// most recent message (offset) and the total number of messages in
+// history (total), including any still sitting in the overflow log,
+// suitable for an outer status bar to render as "N/M".
+func (h *HistoryState) ScrollPosition() (offset, total int) {
+	return h.scrollOffset, len(h.History) + h.overflowed
+}
@@ -0,0 +1,72 @@
+package tui
+
+import (
+	"encoding/gob"
+	"os"
+
+	arbor "github.com/arborchat/arbor-go"
+)
+
+// overflowLog appends messages evicted from a bounded HistoryState to an
+// on-disk gob stream, and can replay that stream back into memory so they
+// can be paged back in. A nil *overflowLog is valid and simply disables
+// overflow persistence.
+type overflowLog struct {
+	path    string
+	file    *os.File
+	encoder *gob.Encoder
+}
+
+// openOverflowLog opens (creating if necessary) the gob-encoded overflow
+// log at path for appending. An empty path disables the overflow log
+// entirely, returning a nil *overflowLog.
+func openOverflowLog(path string) (*overflowLog, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &overflowLog{path: path, file: file, encoder: gob.NewEncoder(file)}, nil
+}
+
+// append writes message to the end of the overflow log.
+func (o *overflowLog) append(message *arbor.ChatMessage) error {
+	if o == nil {
+		return nil
+	}
+	return o.encoder.Encode(message)
+}
+
+// replay reads every message currently in the overflow log, oldest
+// first. It opens its own read handle, so it can be called while the
+// log's write handle is still open for appending.
+func (o *overflowLog) replay() ([]*arbor.ChatMessage, error) {
+	if o == nil {
+		return nil, nil
+	}
+	file, err := os.Open(o.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	decoder := gob.NewDecoder(file)
+	var messages []*arbor.ChatMessage
+	for {
+		var message arbor.ChatMessage
+		if err := decoder.Decode(&message); err != nil {
+			break
+		}
+		messages = append(messages, &message)
+	}
+	return messages, nil
+}
+
+// Close releases the overflow log's write handle.
+func (o *overflowLog) Close() error {
+	if o == nil {
+		return nil
+	}
+	return o.file.Close()
+}
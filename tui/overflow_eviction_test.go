@@ -0,0 +1,94 @@
+package tui
+
+import (
+	"encoding/gob"
+	"os"
+	"testing"
+
+	arbor "github.com/arborchat/arbor-go"
+)
+
+func TestEvictOverflowRepointsCurrent(t *testing.T) {
+	h, err := NewHistoryStateWithOptions(HistoryOptions{Capacity: 1, SpillPath: t.TempDir() + "/overflow.gob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	mustNew := func(uuid string, ts int64) {
+		t.Helper()
+		if err := h.New(&arbor.ChatMessage{UUID: uuid, Timestamp: ts}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mustNew("a", 1)
+	if h.Current() != "a" {
+		t.Fatalf("Current() = %q, want %q", h.Current(), "a")
+	}
+	mustNew("b", 2) // evicts "a", which was current
+	if h.Current() != "b" {
+		t.Fatalf("Current() after evicting the current message = %q, want %q", h.Current(), "b")
+	}
+}
+
+func TestEvictOverflowDoesNotDuplicateLoggedMessages(t *testing.T) {
+	path := t.TempDir() + "/overflow.gob"
+	h, err := NewHistoryStateWithOptions(HistoryOptions{Capacity: 1, SpillPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	mustNew := func(uuid string, ts int64) {
+		t.Helper()
+		if err := h.New(&arbor.ChatMessage{UUID: uuid, Timestamp: ts}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// "a" evicts to the log, gets paged back in, then evicts again without
+	// a genuinely new message ever being written twice.
+	mustNew("a", 1)
+	mustNew("b", 2)
+	h.pageInOverflow()
+	mustNew("c", 3)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dec := gob.NewDecoder(f)
+	seen := map[string]int{}
+	for {
+		var m arbor.ChatMessage
+		if dec.Decode(&m) != nil {
+			break
+		}
+		seen[m.UUID]++
+	}
+	for uuid, count := range seen {
+		if count > 1 {
+			t.Fatalf("message %q appears %d times in the overflow log, want at most 1", uuid, count)
+		}
+	}
+}
+
+func TestScrollPositionIgnoresDiscardedOverflow(t *testing.T) {
+	h, err := NewHistoryStateWithOptions(HistoryOptions{Capacity: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	for i := 0; i < 20; i++ {
+		if err := h.New(&arbor.ChatMessage{UUID: string(rune('a' + i)), Timestamp: int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, total := h.ScrollPosition(); total != 5 {
+		t.Fatalf("ScrollPosition total = %d, want 5 (discarded overflow shouldn't be counted)", total)
+	}
+}
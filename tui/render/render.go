@@ -0,0 +1,89 @@
+// Package render provides an incremental, diffing terminal renderer for the
+// tui package. Instead of repainting an entire frame on every update, it
+// remembers the previously-rendered lines and only repaints the rows that
+// actually changed, moving the cursor with relative escape sequences rather
+// than rewriting untouched rows. The approach is modeled on Bubble Tea's
+// standard renderer.
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Renderer incrementally writes a frame of lines to a terminal, diffing
+// against the previously-rendered frame so that unchanged rows are left
+// untouched. A Renderer is not safe for concurrent use.
+type Renderer struct {
+	// lines holds the previously-rendered frame, keyed by row index.
+	lines []string
+}
+
+// NewRenderer creates an empty Renderer ready to render its first frame.
+func NewRenderer() *Renderer {
+	return &Renderer{}
+}
+
+// Render writes newLines to target, skipping any row whose content is
+// identical to what was written there on the previous call. Changed rows
+// are repainted in place: the cursor is moved with relative up/down escape
+// sequences, the row is cleared, and the new content is written. If
+// newLines is shorter than the previously-rendered frame, the now-unused
+// trailing rows are erased. After Render returns, the cursor sits at the
+// start of the row following the last line.
+func (r *Renderer) Render(target io.Writer, newLines []string) error {
+	var buf bytes.Buffer
+	if len(r.lines) == 0 {
+		// nothing has been painted yet, so there are no existing rows for
+		// the cursor to move into: lay down the whole frame one line per row.
+		for _, line := range newLines {
+			buf.WriteString(line)
+			buf.WriteString("\n")
+		}
+	} else {
+		// cursorRow tracks which row the cursor is on, relative to the top
+		// of the frame, as rows are repainted in order. The previous Render
+		// left it at the start of the row following its last line.
+		cursorRow := len(r.lines)
+		for i, line := range newLines {
+			if i < len(r.lines) && r.lines[i] == line {
+				continue
+			}
+			moveCursor(&buf, i-cursorRow)
+			buf.WriteString("\r\x1b[2K")
+			buf.WriteString(line)
+			cursorRow = i
+		}
+		moveCursor(&buf, len(newLines)-cursorRow)
+		buf.WriteString("\r")
+		if len(r.lines) > len(newLines) {
+			// the previous frame had more rows than this one; erase
+			// everything from here to the end of the screen so the
+			// now-unused trailing rows don't linger.
+			buf.WriteString("\x1b[J")
+		}
+	}
+	if _, err := target.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	r.lines = append(r.lines[:0:0], newLines...)
+	return nil
+}
+
+// Reset discards the cached frame, forcing the next call to Render to
+// repaint every row.
+func (r *Renderer) Reset() {
+	r.lines = nil
+}
+
+// moveCursor appends the escape sequence that moves the cursor delta rows
+// down (positive) or up (negative). A delta of zero writes nothing.
+func moveCursor(buf *bytes.Buffer, delta int) {
+	switch {
+	case delta > 0:
+		fmt.Fprintf(buf, "\x1b[%dB", delta)
+	case delta < 0:
+		fmt.Fprintf(buf, "\x1b[%dA", -delta)
+	}
+}
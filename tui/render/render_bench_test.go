@@ -0,0 +1,84 @@
+package render
+
+import (
+	"fmt"
+	"testing"
+)
+
+// countingWriter discards everything written to it but tallies the bytes,
+// so a benchmark can report how much a Render call actually wrote.
+type countingWriter struct{ n int }
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += len(p)
+	return len(p), nil
+}
+
+// currentColor and clearColor mirror tui.CurrentColor/tui.ClearColor; they
+// can't be imported directly since tui imports this package.
+const (
+	currentColor = "\x1b[0;31m"
+	clearColor   = "\x1b[0;0m"
+)
+
+// cursorFrame builds a height-line viewport of messages, highlighting row
+// current the way HistoryState's UsernameFormatter brackets the
+// currently-selected message in currentColor/clearColor. Only the
+// previously and newly highlighted rows change from one current to the
+// next, which is the typical cursor-move case: everything else on screen
+// is unchanged.
+func cursorFrame(height, width, current int) []string {
+	lines := make([]string, height)
+	for i := range lines {
+		content := fmt.Sprintf("user%d: a message padded out to simulate a width of %d columns", i, width)
+		if i == current {
+			content = currentColor + content + clearColor
+		}
+		lines[i] = content
+	}
+	return lines
+}
+
+// BenchmarkRender_CursorMove measures the bytes Renderer writes as the
+// current-message highlight steps down the viewport one row per call,
+// the common case of CursorDown/CursorUp during Render.
+func BenchmarkRender_CursorMove(b *testing.B) {
+	const height, width = 40, 80
+	r := NewRenderer()
+	var w countingWriter
+	if err := r.Render(&w, cursorFrame(height, width, 0)); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	var totalBytes int
+	for i := 0; i < b.N; i++ {
+		w.n = 0
+		if err := r.Render(&w, cursorFrame(height, width, (i+1)%height)); err != nil {
+			b.Fatal(err)
+		}
+		totalBytes += w.n
+	}
+	b.ReportMetric(float64(totalBytes)/float64(b.N), "bytes/op")
+}
+
+// BenchmarkFullRepaint_CursorMove writes every row on every call, the way
+// HistoryState.Render wrote to its io.Writer before the diffing Renderer
+// replaced it. Comparing its bytes/op against BenchmarkRender_CursorMove
+// shows the reduction the diffing Renderer achieves for a typical
+// cursor-move redraw.
+func BenchmarkFullRepaint_CursorMove(b *testing.B) {
+	const height, width = 40, 80
+	var w countingWriter
+	b.ResetTimer()
+	var totalBytes int
+	for i := 0; i < b.N; i++ {
+		w.n = 0
+		for _, line := range cursorFrame(height, width, (i+1)%height) {
+			if _, err := w.Write([]byte(line + "\n")); err != nil {
+				b.Fatal(err)
+			}
+		}
+		totalBytes += w.n
+	}
+	b.ReportMetric(float64(totalBytes)/float64(b.N), "bytes/op")
+}
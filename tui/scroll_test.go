@@ -0,0 +1,64 @@
+package tui
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	arbor "github.com/arborchat/arbor-go"
+)
+
+// newFilledHistoryState builds a HistoryState with n single-line messages,
+// each uniquely identified by index, ready to be rendered at the given
+// viewport dimensions.
+func newFilledHistoryState(t *testing.T, height, width, n int) *HistoryState {
+	t.Helper()
+	h, err := NewHistoryState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetDimensions(height, width)
+	for i := 0; i < n; i++ {
+		err := h.New(&arbor.ChatMessage{
+			UUID:      string(rune('a' + i)),
+			Username:  "bob",
+			Content:   "msg",
+			Timestamp: int64(i),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return h
+}
+
+func TestRenderFillsViewport(t *testing.T) {
+	tests := []struct {
+		name        string
+		height      int
+		messages    int
+		wantRows    int
+		wantTopHint bool
+	}{
+		{name: "history shorter than viewport", height: 10, messages: 3, wantRows: 10},
+		{name: "history exactly fills viewport", height: 4, messages: 3, wantRows: 4},
+		{name: "history overflows viewport", height: 5, messages: 20, wantRows: 5, wantTopHint: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newFilledHistoryState(t, tt.height, 40, tt.messages)
+			var buf bytes.Buffer
+			if err := h.Render(&buf); err != nil {
+				t.Fatal(err)
+			}
+			rows := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+			if len(rows) != tt.wantRows {
+				t.Fatalf("got %d rows, want %d: %q", len(rows), tt.wantRows, buf.String())
+			}
+			gotTopHint := strings.Contains(buf.String(), "more above")
+			if gotTopHint != tt.wantTopHint {
+				t.Fatalf("more-above indicator present=%v, want %v", gotTopHint, tt.wantTopHint)
+			}
+		})
+	}
+}
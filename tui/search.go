@@ -0,0 +1,170 @@
+package tui
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MatchColor is the ANSI escape sequence used to highlight search matches.
+// It is distinct from CurrentColor so a matched message can show both at
+// once.
+const MatchColor = "\x1b[0;33m"
+
+// SearchOptions configures how Search matches message content.
+type SearchOptions struct {
+	// Regex treats the query as a regular expression instead of a literal
+	// substring.
+	Regex bool
+	// CaseSensitive disables the default case-insensitive matching.
+	CaseSensitive bool
+}
+
+// SearchHit identifies a single match found by Search. Start and End are
+// byte offsets into the matched message's Content.
+type SearchHit struct {
+	UUID       string
+	Start, End int
+}
+
+// searchState holds the results of the most recent Search call and the
+// user's position within them.
+type searchState struct {
+	query string
+	hits  []SearchHit
+	index int // index into hits of the currently-selected match
+}
+
+// Search scans History for matches of query according to opts, in history
+// order. The returned hits also become the active search, so they drive
+// NextMatch/PrevMatch and the match highlighting RenderMessage applies.
+// The cursor jumps to the first hit, if there is one.
+func (h *HistoryState) Search(query string, opts SearchOptions) []SearchHit {
+	var re *regexp.Regexp
+	if opts.Regex {
+		pattern := query
+		if !opts.CaseSensitive {
+			pattern = "(?i)" + pattern
+		}
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			h.search = searchState{}
+			return nil
+		}
+		re = compiled
+	}
+
+	var hits []SearchHit
+	for _, message := range h.History {
+		if re != nil {
+			for _, loc := range re.FindAllStringIndex(message.Content, -1) {
+				hits = append(hits, SearchHit{UUID: message.UUID, Start: loc[0], End: loc[1]})
+			}
+			continue
+		}
+		hits = append(hits, literalHits(message.UUID, message.Content, query, opts.CaseSensitive)...)
+	}
+
+	h.search = searchState{query: query, index: 0, hits: hits}
+	if len(hits) > 0 {
+		h.jumpToHit(hits[0])
+	}
+	return hits
+}
+
+// literalHits finds every non-overlapping occurrence of query within
+// content, honoring caseSensitive.
+func literalHits(uuid, content, query string, caseSensitive bool) []SearchHit {
+	if query == "" {
+		return nil
+	}
+	var hits []SearchHit
+	if !caseSensitive {
+		// match case-folded on content itself so offsets stay valid for
+		// Content even where lowercasing would change a rune's byte length.
+		re := regexp.MustCompile("(?i)" + regexp.QuoteMeta(query))
+		for _, loc := range re.FindAllStringIndex(content, -1) {
+			hits = append(hits, SearchHit{UUID: uuid, Start: loc[0], End: loc[1]})
+		}
+		return hits
+	}
+	haystack, needle := content, query
+	offset := 0
+	for {
+		i := strings.Index(haystack[offset:], needle)
+		if i < 0 {
+			break
+		}
+		start := offset + i
+		end := start + len(needle)
+		hits = append(hits, SearchHit{UUID: uuid, Start: start, End: end})
+		offset = end
+	}
+	return hits
+}
+
+// NextMatch moves the cursor to the next search hit, wrapping around to
+// the first hit after the last. It does nothing if there is no active
+// search or it found no matches.
+func (h *HistoryState) NextMatch() {
+	if len(h.search.hits) == 0 {
+		return
+	}
+	h.search.index = (h.search.index + 1) % len(h.search.hits)
+	h.jumpToHit(h.search.hits[h.search.index])
+}
+
+// PrevMatch moves the cursor to the previous search hit, wrapping around
+// to the last hit before the first. It does nothing if there is no active
+// search or it found no matches.
+func (h *HistoryState) PrevMatch() {
+	if len(h.search.hits) == 0 {
+		return
+	}
+	h.search.index = (h.search.index - 1 + len(h.search.hits)) % len(h.search.hits)
+	h.jumpToHit(h.search.hits[h.search.index])
+}
+
+// jumpToHit marks hit's message as current and scrolls it into view.
+func (h *HistoryState) jumpToHit(hit SearchHit) {
+	for index, msg := range h.History {
+		if msg.UUID == hit.UUID {
+			h.current = hit.UUID
+			h.currentIndex = index
+			break
+		}
+	}
+	h.ScrollTo(hit.UUID)
+}
+
+// ClearSearch discards the active search so RenderMessage stops
+// highlighting matches.
+func (h *HistoryState) ClearSearch() {
+	h.search = searchState{}
+}
+
+// SearchStatus renders the active-search status line, e.g.
+// "match 2/5 for /foo/", suitable for display above the input area. It
+// returns "" if there is no active search.
+func (h *HistoryState) SearchStatus() string {
+	if h.search.query == "" {
+		return ""
+	}
+	if len(h.search.hits) == 0 {
+		return fmt.Sprintf("no matches for /%s/", h.search.query)
+	}
+	return fmt.Sprintf("match %d/%d for /%s/", h.search.index+1, len(h.search.hits), h.search.query)
+}
+
+// hitsForMessage returns the byte ranges within uuid's Content that the
+// active search matched, in the [start, end) form wrapAndHighlight
+// expects.
+func (h *HistoryState) hitsForMessage(uuid string) [][2]int {
+	var ranges [][2]int
+	for _, hit := range h.search.hits {
+		if hit.UUID == uuid {
+			ranges = append(ranges, [2]int{hit.Start, hit.End})
+		}
+	}
+	return ranges
+}
@@ -0,0 +1,52 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestWrapAndHighlightSurvivesMidWordWrap guards the offset remapping
+// between a message's raw Content and the string runewidth.Wrap produces
+// from it. A single token wider than the wrap width forces a hard-wrap
+// newline that doesn't consume any bytes from Content, which previously
+// desynced every highlight offset after that point.
+func TestWrapAndHighlightSurvivesMidWordWrap(t *testing.T) {
+	content := "this is a very very very long unbrokenwordthatexceedswidth needle-here after"
+	needle := "needle-here"
+	start := strings.Index(content, needle)
+	highlights := [][2]int{{start, start + len(needle)}}
+
+	lines := wrapAndHighlight(content, 20, "", "", false, highlights)
+	var joined strings.Builder
+	for _, line := range lines {
+		joined.Write(line)
+	}
+	out := joined.String()
+
+	// the match is highlighted in full, and the color escapes bracket
+	// exactly the matched runes on each of the two hard-wrapped lines it
+	// straddles (the newline between them stays outside the escapes),
+	// never some shifted substring like "ious needl" from the old
+	// content-offset bug.
+	var stripped strings.Builder
+	inEscape := false
+	for i := 0; i < len(out); i++ {
+		switch {
+		case strings.HasPrefix(out[i:], MatchColor):
+			i += len(MatchColor) - 1
+			inEscape = true
+			continue
+		case strings.HasPrefix(out[i:], ClearColor):
+			i += len(ClearColor) - 1
+			inEscape = false
+			continue
+		}
+		if inEscape {
+			stripped.WriteByte(out[i])
+		}
+	}
+	highlighted := stripped.String()
+	if highlighted != needle {
+		t.Fatalf("highlighted text = %q, want %q (full output: %q)", highlighted, needle, out)
+	}
+}